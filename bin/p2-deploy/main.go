@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/square/p2/Godeps/_workspace/src/github.com/hashicorp/consul/api"
+	"github.com/square/p2/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
+
+	"github.com/square/p2/pkg/deployment"
+	"github.com/square/p2/pkg/kp/rcstore"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/util/net"
+	"github.com/square/p2/pkg/version"
+)
+
+var (
+	deploy = kingpin.New("p2-deploy", `p2-deploy manages a Deployment resource: a higher-level object that gradually replaces the RCs matching a selector with a new RC carrying an updated pod manifest, analogous to a Kubernetes Deployment.
+
+	Example invocation: p2-deploy create --node-selector=app=helloworld --pod-label=app=helloworld --replicas=3 --max-surge=1 --max-unavailable=1 /tmp/helloworld.yaml
+
+	To roll out a new manifest for an existing deployment: p2-deploy update --id=<deployment-id> /tmp/helloworld-v2.yaml
+	`)
+	consulUrl   = deploy.Flag("consul", "The hostname and port of a consul agent in the p2 cluster. Defaults to 0.0.0.0:8500.").String()
+	consulToken = deploy.Flag("token", "The ACL token to use for consul").String()
+	headers     = deploy.Flag("header", "An HTTP header to add to requests, in KEY=VALUE form. Can be specified multiple times.").StringMap()
+	https       = deploy.Flag("https", "Use HTTPS").Bool()
+
+	createCmd         = deploy.Command("create", "Create a new deployment and reconcile it until this process is killed")
+	createManifestUri = createCmd.Arg("manifest", "a path or url to a pod manifest that this deployment should converge its RCs towards.").Required().String()
+	nodeSelectorFlag  = createCmd.Flag("node-selector", "A selector specifying what nodes new RCs created by this deployment may schedule to").Required().String()
+	podLabelFlag      = createCmd.Flag("pod-label", "A label to apply to every RC and pod this deployment creates, in KEY=VALUE form. Can be specified multiple times. RCSelector is derived from these same labels, so every RC created here is always found again on the next reconcile.").Required().StringMap()
+	replicas          = createCmd.Flag("replicas", "The steady-state number of replicas this deployment should converge to").Default("1").Int()
+	maxSurge          = createCmd.Flag("max-surge", "How many replicas beyond --replicas may exist while the rollout is in progress").Default("1").Int()
+	maxUnavailable    = createCmd.Flag("max-unavailable", "How many of --replicas may be unavailable while the rollout is in progress").Default("0").Int()
+
+	updateCmd         = deploy.Command("update", "Point an existing deployment at a new manifest, triggering a rollout")
+	updateID          = updateCmd.Flag("id", "The ID of the deployment to update").Required().String()
+	updateManifestUri = updateCmd.Arg("manifest", "a path or url to the new pod manifest").Required().String()
+
+	pauseCmd = deploy.Command("pause", "Stop a deployment from adjusting replica counts until it is resumed")
+	pauseID  = pauseCmd.Flag("id", "The ID of the deployment to pause").Required().String()
+
+	resumeCmd = deploy.Command("resume", "Resume a deployment previously stopped with pause")
+	resumeID  = resumeCmd.Flag("id", "The ID of the deployment to resume").Required().String()
+
+	rollbackCmd = deploy.Command("rollback", "Make the RC with the given pod-template-sha the new RC again")
+	rollbackID  = rollbackCmd.Flag("id", "The ID of the deployment to roll back").Required().String()
+	rollbackSHA = rollbackCmd.Arg("sha", "the pod-template-sha to roll back to").Required().String()
+)
+
+func consulClient(httpClient *http.Client) *api.Client {
+	conf := api.DefaultConfig()
+	conf.HttpClient = httpClient
+	conf.Token = *consulToken
+	if *consulUrl != "" {
+		conf.Address = *consulUrl
+	}
+	if *https {
+		conf.Scheme = "https"
+	}
+	// error is always nil
+	consulClient, _ := api.NewClient(conf)
+	return consulClient
+}
+
+// rcSelectorFromPodLabels derives an equality selector over podLabels, so
+// that an RC labeled with exactly podLabels always satisfies it. Keeping
+// RCSelector tied to PodLabels this way is what lets the controller always
+// rediscover the RCs it creates, instead of leaking a new RC every
+// reconcile -- see pkg/deployment.Deployment.RCSelector.
+func rcSelectorFromPodLabels(podLabels labels.Set) (labels.Selector, error) {
+	keys := make([]string, 0, len(podLabels))
+	for k := range podLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	query := ""
+	for i, k := range keys {
+		if i > 0 {
+			query += ","
+		}
+		query += fmt.Sprintf("%s=%s", k, podLabels[k])
+	}
+	return labels.Parse(query)
+}
+
+func main() {
+	deploy.Version(version.VERSION)
+	cmd := kingpin.MustParse(deploy.Parse(os.Args[1:]))
+
+	logger := logging.DefaultLogger
+
+	httpClient := net.NewHeaderClient(*headers, http.DefaultTransport)
+	client := consulClient(httpClient)
+
+	rcStore := rcstore.NewConsul(client, 3, logging.DefaultLogger)
+	deploymentStore := deployment.NewConsul(client, 3)
+	controller := deployment.NewController(deploymentStore, rcStore, logger)
+
+	switch cmd {
+	case createCmd.FullCommand():
+		manifest, err := pods.ManifestFromURI(*createManifestUri)
+		if err != nil {
+			log.Fatalf("Couldn't read manifest: %s", err)
+		}
+
+		nodeSelector, err := labels.Parse(*nodeSelectorFlag)
+		if err != nil {
+			log.Fatalf("Invalid node selector: %s", err)
+		}
+
+		podLabels := labels.Set(*podLabelFlag)
+		rcSelector, err := rcSelectorFromPodLabels(podLabels)
+		if err != nil {
+			log.Fatalf("Couldn't derive RC selector from --pod-label: %s", err)
+		}
+
+		created, err := deploymentStore.Create(manifest, nodeSelector, rcSelector, podLabels, *replicas, *maxSurge, *maxUnavailable)
+		if err != nil {
+			log.Fatalf("Couldn't create deployment: %s", err)
+		}
+		log.Printf("Created deployment %s, reconciling every 10s. Ctrl-C to stop.", created.ID)
+
+		quit := make(chan struct{})
+		go controller.Run(10*time.Second, quit)
+
+		// Block forever; operators interact with this deployment via
+		// `p2-deploy pause/resume/rollback/update` from another invocation
+		// while this process keeps reconciling it.
+		select {}
+
+	case updateCmd.FullCommand():
+		manifest, err := pods.ManifestFromURI(*updateManifestUri)
+		if err != nil {
+			log.Fatalf("Couldn't read manifest: %s", err)
+		}
+
+		d, err := deploymentStore.Get(deployment.ID(*updateID))
+		if err != nil {
+			log.Fatalf("Couldn't get deployment %s: %s", *updateID, err)
+		}
+		d.Manifest = manifest
+		if err := deploymentStore.Put(d); err != nil {
+			log.Fatalf("Couldn't update deployment %s: %s", *updateID, err)
+		}
+		log.Printf("Updated deployment %s's manifest; its running reconciler will pick this up within one interval.", d.ID)
+
+	case pauseCmd.FullCommand():
+		if err := controller.Pause(deployment.ID(*pauseID)); err != nil {
+			log.Fatalf("Couldn't pause deployment %s: %s", *pauseID, err)
+		}
+		log.Printf("Paused deployment %s", *pauseID)
+
+	case resumeCmd.FullCommand():
+		if err := controller.Resume(deployment.ID(*resumeID)); err != nil {
+			log.Fatalf("Couldn't resume deployment %s: %s", *resumeID, err)
+		}
+		log.Printf("Resumed deployment %s", *resumeID)
+
+	case rollbackCmd.FullCommand():
+		if err := controller.Rollback(deployment.ID(*rollbackID), *rollbackSHA); err != nil {
+			log.Fatalf("Couldn't roll back deployment %s: %s", *rollbackID, err)
+		}
+		log.Printf("Requested rollback of deployment %s to pod-template-sha %s; its running reconciler will action this within one interval.", *rollbackID, *rollbackSHA)
+	}
+}
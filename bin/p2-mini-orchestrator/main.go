@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"time"
 
 	"github.com/square/p2/Godeps/_workspace/src/github.com/hashicorp/consul/api"
 	"github.com/square/p2/Godeps/_workspace/src/gopkg.in/alecthomas/kingpin.v1"
@@ -38,6 +37,8 @@ var (
 	nodeEndpoint = replicate.Flag("node-endpoint", "An endpoint to query for node selector matches").String()
 	nodes        = replicate.Flag("nodes", "The number of nodes to replicate to").Default("1").Int()
 	https        = replicate.Flag("https", "Use HTTPS").Bool()
+	spreadBy     = replicate.Flag("spread-by", "A pod label to spread by, e.g. service=foo. When set, nodes already carrying pods matching this label are deprioritized.").String()
+	adopt        = replicate.Flag("adopt", "Fold orphan pods already running this manifest on a matching node into the RC instead of scheduling duplicates").Bool()
 )
 
 func consulClient(httpClient *http.Client) *api.Client {
@@ -55,7 +56,7 @@ func consulClient(httpClient *http.Client) *api.Client {
 	return consulClient
 }
 
-func scheduler(httpClient *http.Client) rc.Scheduler {
+func scheduler(httpClient *http.Client, podApplicator labels.Applicator) rc.Scheduler {
 	nodeUrl, err := url.Parse(*nodeEndpoint)
 	if err != nil {
 		log.Fatalf("Couldn't parse node endpoint: %s", err)
@@ -66,7 +67,18 @@ func scheduler(httpClient *http.Client) rc.Scheduler {
 		log.Fatalf("Couldn't create node applicator: %s", err)
 	}
 
-	return rc.NewApplicatorScheduler(nodeApplicator)
+	baseScheduler := rc.NewApplicatorScheduler(nodeApplicator)
+
+	if *spreadBy == "" {
+		return baseScheduler
+	}
+
+	spreadKey, err := labels.Parse(*spreadBy)
+	if err != nil {
+		log.Fatalf("Invalid spread-by selector: %s", err)
+	}
+
+	return rc.NewSpreadScheduler(baseScheduler, podApplicator, spreadKey)
 }
 
 func makeRcFields(stores ...rcstore.Store) []fields.RC {
@@ -154,6 +166,7 @@ func makeRcFields(stores ...rcstore.Store) []fields.RC {
 			log.Fatalf("List of store %s didn't list the just-created RC! +%v, looking for %s", i, listeds, fields.ID)
 		}
 
+		fields.AdoptExisting = *adopt
 		rcs[i] = fields
 	}
 
@@ -203,7 +216,7 @@ func main() {
 
 	// TODO: Should the number of retries be configurable?
 	podApplicator := labels.NewConsulApplicator(consulClient, 3)
-	scheduler := scheduler(httpClient)
+	scheduler := scheduler(httpClient, podApplicator)
 
 	replicationController := rc.New(
 		consulFields,
@@ -219,6 +232,16 @@ func main() {
 	}
 	log.Printf("RC labels y'all: %+v", labeled.Labels)
 
+	if *adopt {
+		// WatchDesires below also adopts orphans on every reconcile tick, so
+		// this isn't load-bearing -- it just saves the first tick's worth of
+		// delay before any orphans already on the cluster get folded in.
+		log.Println("Adopting orphan pods before we start scheduling, y'all.")
+		if err := replicationController.AdoptOrphans(); err != nil {
+			log.Fatalf("Couldn't adopt orphans: %s", err)
+		}
+	}
+
 	quit := make(chan struct{})
 	errors := replicationController.WatchDesires(quit)
 
@@ -228,18 +251,20 @@ func main() {
 		log.Fatalf("Couldn't set desired to %d: %s", *nodes, err)
 	}
 
+	watchNodesQuit := make(chan struct{})
+	currentNodesCh, currentNodesErrs := replicationController.WatchCurrentNodes(watchNodesQuit)
+
 	currentNodes := []string{}
 
 	for len(currentNodes) != *nodes {
-		// TODO: Does this sleep loop imply we want a replicationController.WatchCurrentNodes() ???
-		time.Sleep(3 * time.Second)
-		var err error
-		currentNodes, err = replicationController.CurrentNodes()
-		if err != nil {
-			log.Fatalf("Couldn't get current nodes: %s", err)
+		select {
+		case err := <-currentNodesErrs:
+			log.Fatalf("Couldn't watch current nodes: %s", err)
+		case currentNodes = <-currentNodesCh:
+			log.Printf("Currently on %v", currentNodes)
 		}
-		log.Printf("Currently on %v", currentNodes)
 	}
+	close(watchNodesQuit)
 
 	go func() {
 		for err := range errors {
@@ -49,7 +49,18 @@ func main() {
 	go prep.WatchForPodManifestsForNode(successMainUpdate, errMainUpdate, quitMainUpdate)
 	go prep.WatchForHooks(successHookUpdate, errHookUpdate, quitHookUpdate)
 
-	http.HandleFunc("/_status", statusHandler(successMainUpdate, successHookUpdate, errMainUpdate, errHookUpdate))
+	metrics := prep.Metrics()
+	go watchForErrors(successMainUpdate, errMainUpdate, metrics.RecordPodWatchSuccess, metrics.RecordPodWatchError)
+	go watchForErrors(successHookUpdate, errHookUpdate, metrics.RecordHookWatchSuccess, metrics.RecordHookWatchError)
+
+	readyThreshold := preparerConfig.StatusReadyThreshold
+	if readyThreshold == 0 {
+		readyThreshold = defaultStatusReadyThreshold
+	}
+
+	http.HandleFunc("/_status/live", liveHandler)
+	http.HandleFunc("/_status/ready", readyHandler(metrics, readyThreshold))
+	http.HandleFunc("/metrics", metricsHandler(metrics))
 	go http.ListenAndServe(":8080", nil)
 
 	waitForTermination(logger, quitMainUpdate, quitHookUpdate)
@@ -57,44 +68,57 @@ func main() {
 	logger.NoFields().Infoln("Terminating")
 }
 
-func watchForErrors(successes <-chan struct{}, errs <-chan error, consecutive *int, lastError *error) {
+// defaultStatusReadyThreshold is how many consecutive watch errors are
+// tolerated before /_status/ready starts returning 503, if PreparerConfig
+// doesn't specify its own threshold.
+const defaultStatusReadyThreshold = 3
+
+// watchForErrors drives onSuccess/onError off of a watch loop's success and
+// error channels for as long as the process runs. It no longer owns any
+// state itself -- onSuccess/onError update a shared *preparer.Metrics via
+// atomic operations, so /_status/ready and /metrics always see the same
+// counts instead of each watchHandler keeping its own int pointer.
+func watchForErrors(successes <-chan struct{}, errs <-chan error, onSuccess, onError func()) {
 	for {
 		select {
-		case err := <-errs:
-			*lastError = err
-			*consecutive++
+		case <-errs:
+			onError()
 		case <-successes:
-			*consecutive = 0
+			onSuccess()
 		}
 	}
 }
 
-func statusHandler(mainSuccesses, hookSuccesses <-chan struct{}, mainErrors, hookErrors <-chan error) http.HandlerFunc {
-	consecutiveMainErrors := 0
-	consecutiveHookErrors := 0
-	var lastMainError error
-	var lastHookError error
-
-	go watchForErrors(mainSuccesses, mainErrors, &consecutiveMainErrors, &lastMainError)
-	go watchForErrors(hookSuccesses, hookErrors, &consecutiveHookErrors, &lastHookError)
+// liveHandler always returns 200 while the process is up; it does not
+// consult metrics, since it exists to distinguish "process is up" from
+// "watchers are healthy" (that's /_status/ready).
+func liveHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "OK")
+}
 
+// readyHandler returns 503 once either watch loop has accumulated more than
+// threshold consecutive errors, and 200 otherwise.
+func readyHandler(metrics *preparer.Metrics, threshold int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		status := "OK"
-
-		type StatusResponse struct {
+		type ReadyResponse struct {
 			Status                string `json:"status"`
-			ConsecutiveHookErrors int    `json:"consecutive_hook_errors"`
-			ConsecutivePodErrors  int    `json:"consecutive_pod_errors"`
-			LastHookError         string `json:"last_hook_error"`
-			LastPodError          string `json:"last_pod_error"`
+			ConsecutivePodErrors  uint64 `json:"consecutive_pod_errors"`
+			ConsecutiveHookErrors uint64 `json:"consecutive_hook_errors"`
 		}
 
-		response, err := json.Marshal(StatusResponse{
+		podErrors := metrics.ConsecutivePodErrors()
+		hookErrors := metrics.ConsecutiveHookErrors()
+
+		status := "OK"
+		if podErrors > uint64(threshold) || hookErrors > uint64(threshold) {
+			status = "Not ready"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		response, err := json.Marshal(ReadyResponse{
 			Status:                status,
-			ConsecutiveHookErrors: consecutiveHookErrors,
-			ConsecutivePodErrors:  consecutiveMainErrors,
-			LastHookError:         fmt.Sprintf("%+v", lastHookError),
-			LastPodError:          fmt.Sprintf("%+v", lastMainError),
+			ConsecutivePodErrors:  podErrors,
+			ConsecutiveHookErrors: hookErrors,
 		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -105,6 +129,13 @@ func statusHandler(mainSuccesses, hookSuccesses <-chan struct{}, mainErrors, hoo
 	}
 }
 
+// metricsHandler exposes metrics in Prometheus text exposition format.
+func metricsHandler(metrics *preparer.Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics.WritePrometheus(w)
+	}
+}
+
 func waitForTermination(logger logging.Logger, quitMainUpdate, quitHookUpdate chan struct{}) {
 	signalCh := make(chan os.Signal, 2)
 	signal.Notify(signalCh, syscall.SIGTERM, os.Interrupt)
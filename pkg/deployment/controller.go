@@ -0,0 +1,251 @@
+package deployment
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/kp/rcstore"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/rc/fields"
+	"github.com/square/p2/pkg/util"
+)
+
+// Controller reconciles Deployments in a Store against the RCs in an
+// rcstore.Store, gradually shifting replicas from old RCs to a new one
+// until the new RC carries ReplicasDesired on its own.
+type Controller struct {
+	rcs    rcstore.Store
+	store  Store
+	logger logging.Logger
+}
+
+// NewController returns a Controller that reconciles deployments in store
+// against RCs in rcs.
+func NewController(store Store, rcs rcstore.Store, logger logging.Logger) *Controller {
+	return &Controller{
+		rcs:    rcs,
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Run reconciles every known deployment once per interval until quit is
+// closed, logging (but not dying on) individual reconciliation errors so
+// one broken deployment does not stall the others.
+func (c *Controller) Run(interval time.Duration, quit <-chan struct{}) {
+	for {
+		select {
+		case <-quit:
+			return
+		case <-time.After(interval):
+			deployments, err := c.store.List()
+			if err != nil {
+				c.logger.WithError(err).Errorln("could not list deployments")
+				continue
+			}
+			for _, d := range deployments {
+				if err := c.reconcile(d); err != nil {
+					c.logger.WithError(err).Errorf("could not reconcile deployment %s", d.ID)
+				}
+			}
+		}
+	}
+}
+
+// oldAndNewRCs splits the RCs matching d.RCSelector into the single RC
+// whose stored manifest SHA matches d.Manifest (the "new" RC, which may not
+// exist yet) and the remainder (the "old" RCs).
+func (c *Controller) oldAndNewRCs(d Deployment) (newRC *fields.RC, oldRCs []fields.RC, err error) {
+	desiredSHA, err := d.Manifest.SHA()
+	if err != nil {
+		return nil, nil, util.Errorf("could not compute manifest SHA for deployment %s: %s", d.ID, err)
+	}
+
+	all, err := c.rcs.List()
+	if err != nil {
+		return nil, nil, util.Errorf("could not list RCs: %s", err)
+	}
+
+	for i := range all {
+		rc := all[i]
+		if !d.RCSelector.Matches(rc.PodLabels) {
+			continue
+		}
+
+		sha, err := rc.Manifest.SHA()
+		if err != nil {
+			return nil, nil, util.Errorf("could not compute manifest SHA for RC %s: %s", rc.ID, err)
+		}
+
+		if sha == desiredSHA {
+			rcCopy := rc
+			newRC = &rcCopy
+		} else {
+			oldRCs = append(oldRCs, rc)
+		}
+	}
+
+	return newRC, oldRCs, nil
+}
+
+// newRCLabels derives the pod-template-sha labeled identity of the RC this
+// deployment creates for a given manifest SHA.
+func (c *Controller) newRCLabels(d Deployment, sha string) labels.Set {
+	podLabels := labels.Set{}
+	for k, v := range d.PodLabels {
+		podLabels[k] = v
+	}
+	podLabels[DeploymentIDLabel] = d.ID.String()
+	podLabels[PodTemplateSHALabel] = sha
+	return podLabels
+}
+
+// reconcile brings one deployment's RCs one step closer to the desired
+// state: it creates the new RC if necessary, then nudges replica counts on
+// the new and old RCs within MaxSurge/MaxUnavailable bounds.
+func (c *Controller) reconcile(d Deployment) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	if d.Paused {
+		return nil
+	}
+
+	if d.RollbackToSHA != "" {
+		return c.rollback(d)
+	}
+
+	newRC, oldRCs, err := c.oldAndNewRCs(d)
+	if err != nil {
+		return err
+	}
+
+	if newRC == nil {
+		sha, err := d.Manifest.SHA()
+		if err != nil {
+			return util.Errorf("could not compute manifest SHA for deployment %s: %s", d.ID, err)
+		}
+
+		created, err := c.rcs.Create(d.Manifest, d.NodeSelector, c.newRCLabels(d, sha))
+		if err != nil {
+			return util.Errorf("could not create new RC for deployment %s: %s", d.ID, err)
+		}
+		newRC = &created
+	}
+
+	totalOld := 0
+	for _, old := range oldRCs {
+		totalOld += old.ReplicasDesired
+	}
+
+	maxTotal := d.ReplicasDesired + d.MaxSurge
+	minAvailable := d.ReplicasDesired - d.MaxUnavailable
+
+	if newRC.ReplicasDesired < d.ReplicasDesired {
+		// Surge: grow the new RC if MaxSurge leaves us room.
+		if newRC.ReplicasDesired+totalOld < maxTotal {
+			if err := c.rcs.SetDesiredReplicas(newRC.ID, newRC.ReplicasDesired+1); err != nil {
+				return util.Errorf("could not grow new RC %s: %s", newRC.ID, err)
+			}
+			return nil
+		}
+
+		// No surge room left (this is the common case when MaxSurge is 0):
+		// shrink the oldest old RC by one first, to make room for the new
+		// RC to grow on the next reconcile, as long as doing so wouldn't
+		// dip below MinAvailable.
+		if len(oldRCs) > 0 {
+			oldest := oldestRC(oldRCs)
+			if oldest.ReplicasDesired > 0 && totalOld-1+newRC.ReplicasDesired >= minAvailable {
+				if err := c.rcs.SetDesiredReplicas(oldest.ID, oldest.ReplicasDesired-1); err != nil {
+					return util.Errorf("could not shrink old RC %s: %s", oldest.ID, err)
+				}
+			}
+		}
+
+		return nil
+	}
+
+	// The new RC has reached its target; clean up any old replicas left
+	// over from surging, same availability check as above.
+	if len(oldRCs) > 0 {
+		oldest := oldestRC(oldRCs)
+		if oldest.ReplicasDesired > 0 && totalOld-1+newRC.ReplicasDesired >= minAvailable {
+			if err := c.rcs.SetDesiredReplicas(oldest.ID, oldest.ReplicasDesired-1); err != nil {
+				return util.Errorf("could not shrink old RC %s: %s", oldest.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// oldestRC returns the RC that was created first, so callers shrink old RCs
+// in creation order rather than an arbitrary one -- RC IDs are UUIDs and
+// carry no ordering of their own.
+func oldestRC(rcs []fields.RC) fields.RC {
+	oldest := rcs[0]
+	for _, rc := range rcs[1:] {
+		if rc.CreatedAt.Before(oldest.CreatedAt) {
+			oldest = rc
+		}
+	}
+	return oldest
+}
+
+// Pause stops the controller from adjusting replica counts for id until it
+// is resumed.
+func (c *Controller) Pause(id ID) error {
+	d, err := c.store.Get(id)
+	if err != nil {
+		return err
+	}
+	d.Paused = true
+	return c.store.Put(d)
+}
+
+// Resume un-pauses a deployment previously stopped with Pause.
+func (c *Controller) Resume(id ID) error {
+	d, err := c.store.Get(id)
+	if err != nil {
+		return err
+	}
+	d.Paused = false
+	return c.store.Put(d)
+}
+
+// Rollback asks the controller to make the RC whose pod-template SHA is
+// sha the new RC again, reverting whatever manifest the deployment
+// currently targets.
+func (c *Controller) Rollback(id ID, sha string) error {
+	d, err := c.store.Get(id)
+	if err != nil {
+		return err
+	}
+	d.RollbackToSHA = sha
+	return c.store.Put(d)
+}
+
+// rollback actions a pending rollback by finding the RC with the requested
+// SHA and adopting its manifest as the deployment's desired manifest, then
+// clearing RollbackToSHA so future reconciles proceed normally.
+func (c *Controller) rollback(d Deployment) error {
+	_, oldRCs, err := c.oldAndNewRCs(d)
+	if err != nil {
+		return err
+	}
+
+	for _, old := range oldRCs {
+		sha, err := old.Manifest.SHA()
+		if err != nil {
+			continue
+		}
+		if sha == d.RollbackToSHA {
+			d.Manifest = old.Manifest
+			d.RollbackToSHA = ""
+			return c.store.Put(d)
+		}
+	}
+
+	return util.Errorf("no RC with pod-template-sha %s found for deployment %s, cannot roll back", d.RollbackToSHA, d.ID)
+}
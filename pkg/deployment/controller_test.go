@@ -0,0 +1,321 @@
+package deployment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/kp/rcstore"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+)
+
+// fakeManifest is a minimal pods.Manifest for exercising the controller
+// without a real pod manifest parser.
+type fakeManifest struct {
+	id  string
+	sha string
+}
+
+func (m fakeManifest) ID() string              { return m.id }
+func (m fakeManifest) SHA() (string, error)     { return m.sha, nil }
+func (m fakeManifest) Marshal() ([]byte, error) { return []byte(m.id + ":" + m.sha), nil }
+
+// allSelector matches every label set; tests don't need real selector
+// syntax to exercise the reconcile loop.
+type allSelector struct{}
+
+func (allSelector) Matches(labels.Set) bool { return true }
+func (allSelector) String() string          { return "" }
+
+func TestReconcileCreatesNewRCAndSurges(t *testing.T) {
+	rcs := rcstore.NewFake()
+	store := NewFake()
+	logger := logging.DefaultLogger
+
+	oldManifest := fakeManifest{id: "helloworld", sha: "oldsha"}
+	newManifest := fakeManifest{id: "helloworld", sha: "newsha"}
+
+	oldRC, err := rcs.Create(oldManifest, allSelector{}, labels.Set{"deployment-id": "dep1"})
+	if err != nil {
+		t.Fatalf("could not seed old RC: %s", err)
+	}
+	if err := rcs.SetDesiredReplicas(oldRC.ID, 3); err != nil {
+		t.Fatalf("could not set old RC replicas: %s", err)
+	}
+
+	d := Deployment{
+		ID:              ID("dep1"),
+		Manifest:        newManifest,
+		RCSelector:      allSelector{},
+		NodeSelector:    allSelector{},
+		PodLabels:       labels.Set{},
+		ReplicasDesired: 3,
+		MaxSurge:        1,
+		MaxUnavailable:  0,
+	}
+
+	c := NewController(store, rcs, logger)
+
+	// First reconcile creates the new RC.
+	if err := c.reconcile(d); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+
+	newRC, oldRCs, err := c.oldAndNewRCs(d)
+	if err != nil {
+		t.Fatalf("could not inspect RCs: %s", err)
+	}
+	if newRC == nil {
+		t.Fatal("expected a new RC to have been created")
+	}
+	if len(oldRCs) != 1 {
+		t.Fatalf("expected exactly one old RC, got %d", len(oldRCs))
+	}
+
+	// Drive reconcile until the new RC fully owns ReplicasDesired and the
+	// old RC has been scaled to zero.
+	for i := 0; i < 20; i++ {
+		if err := c.reconcile(d); err != nil {
+			t.Fatalf("reconcile %d failed: %s", i, err)
+		}
+	}
+
+	newRC, oldRCs, err = c.oldAndNewRCs(d)
+	if err != nil {
+		t.Fatalf("could not inspect RCs: %s", err)
+	}
+	if newRC.ReplicasDesired != 3 {
+		t.Errorf("expected new RC to converge to 3 replicas, got %d", newRC.ReplicasDesired)
+	}
+	for _, old := range oldRCs {
+		if old.ReplicasDesired != 0 {
+			t.Errorf("expected old RC %s to be scaled to 0, got %d", old.ID, old.ReplicasDesired)
+		}
+	}
+}
+
+func TestReconcileProgressesWithZeroMaxSurge(t *testing.T) {
+	rcs := rcstore.NewFake()
+	store := NewFake()
+	logger := logging.DefaultLogger
+
+	oldManifest := fakeManifest{id: "helloworld", sha: "oldsha"}
+	newManifest := fakeManifest{id: "helloworld", sha: "newsha"}
+
+	oldRC, err := rcs.Create(oldManifest, allSelector{}, labels.Set{"deployment-id": "dep1"})
+	if err != nil {
+		t.Fatalf("could not seed old RC: %s", err)
+	}
+	if err := rcs.SetDesiredReplicas(oldRC.ID, 3); err != nil {
+		t.Fatalf("could not set old RC replicas: %s", err)
+	}
+
+	d := Deployment{
+		ID:              ID("dep1"),
+		Manifest:        newManifest,
+		RCSelector:      allSelector{},
+		NodeSelector:    allSelector{},
+		PodLabels:       labels.Set{},
+		ReplicasDesired: 3,
+		MaxSurge:        0,
+		MaxUnavailable:  1,
+	}
+
+	c := NewController(store, rcs, logger)
+
+	for i := 0; i < 20; i++ {
+		if err := c.reconcile(d); err != nil {
+			t.Fatalf("reconcile %d failed: %s", i, err)
+		}
+	}
+
+	newRC, oldRCs, err := c.oldAndNewRCs(d)
+	if err != nil {
+		t.Fatalf("could not inspect RCs: %s", err)
+	}
+	if newRC == nil || newRC.ReplicasDesired != 3 {
+		t.Fatalf("expected the zero-surge rollout to converge to 3 replicas on the new RC, got %+v", newRC)
+	}
+	for _, old := range oldRCs {
+		if old.ReplicasDesired != 0 {
+			t.Errorf("expected old RC %s to be scaled to 0, got %d", old.ID, old.ReplicasDesired)
+		}
+	}
+}
+
+// TestReconcileShrinksOldestRCFirst seeds two old RCs with distinct
+// CreatedAt times and checks that the one created first is the one
+// reconcile shrinks, exercising oldestRC's ordering rather than the
+// single-old-RC case every other test here uses.
+func TestReconcileShrinksOldestRCFirst(t *testing.T) {
+	rcs := rcstore.NewFake()
+	store := NewFake()
+	logger := logging.DefaultLogger
+
+	oldManifest := fakeManifest{id: "helloworld", sha: "oldsha"}
+	newManifest := fakeManifest{id: "helloworld", sha: "newsha"}
+
+	rc1, err := rcs.Create(oldManifest, allSelector{}, labels.Set{"deployment-id": "dep1"})
+	if err != nil {
+		t.Fatalf("could not seed rc1: %s", err)
+	}
+	if err := rcs.SetDesiredReplicas(rc1.ID, 2); err != nil {
+		t.Fatalf("could not set rc1 replicas: %s", err)
+	}
+
+	// Sleep a bit so rc2's CreatedAt is unambiguously later than rc1's.
+	time.Sleep(10 * time.Millisecond)
+
+	rc2, err := rcs.Create(oldManifest, allSelector{}, labels.Set{"deployment-id": "dep1"})
+	if err != nil {
+		t.Fatalf("could not seed rc2: %s", err)
+	}
+	if err := rcs.SetDesiredReplicas(rc2.ID, 1); err != nil {
+		t.Fatalf("could not set rc2 replicas: %s", err)
+	}
+
+	d := Deployment{
+		ID:              ID("dep1"),
+		Manifest:        newManifest,
+		RCSelector:      allSelector{},
+		NodeSelector:    allSelector{},
+		PodLabels:       labels.Set{},
+		ReplicasDesired: 3,
+		MaxSurge:        0,
+		MaxUnavailable:  1,
+	}
+
+	c := NewController(store, rcs, logger)
+
+	// One reconcile: creates the new RC (0 replicas), finds no surge room
+	// (totalOld 3 == maxTotal 3), and shrinks the oldest old RC by one.
+	if err := c.reconcile(d); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+
+	got1, err := rcs.Get(rc1.ID)
+	if err != nil {
+		t.Fatalf("could not get rc1: %s", err)
+	}
+	got2, err := rcs.Get(rc2.ID)
+	if err != nil {
+		t.Fatalf("could not get rc2: %s", err)
+	}
+
+	if got1.ReplicasDesired != 1 {
+		t.Errorf("expected rc1 (created first) to shrink from 2 to 1, got %d", got1.ReplicasDesired)
+	}
+	if got2.ReplicasDesired != 1 {
+		t.Errorf("expected rc2 (created second) to be left alone at 1, got %d", got2.ReplicasDesired)
+	}
+}
+
+// TestReconcileWithRealSelectorRediscoversNewRC uses an actual
+// labels.Parse-built selector, rather than allSelector{}, to exercise the
+// chunk0-1 fix: every RC this deployment creates must carry PodLabels that
+// satisfy RCSelector, or the controller can never find the RC it just
+// created on the next reconcile and will keep creating new ones forever.
+func TestReconcileWithRealSelectorRediscoversNewRC(t *testing.T) {
+	rcs := rcstore.NewFake()
+	store := NewFake()
+	logger := logging.DefaultLogger
+
+	manifest := fakeManifest{id: "helloworld", sha: "sha1"}
+
+	rcSelector, err := labels.Parse("app=foo")
+	if err != nil {
+		t.Fatalf("could not parse selector: %s", err)
+	}
+
+	d := Deployment{
+		ID:              ID("dep1"),
+		Manifest:        manifest,
+		RCSelector:      rcSelector,
+		NodeSelector:    allSelector{},
+		PodLabels:       labels.Set{"app": "foo"},
+		ReplicasDesired: 1,
+		MaxSurge:        1,
+		MaxUnavailable:  0,
+	}
+
+	c := NewController(store, rcs, logger)
+
+	if err := c.reconcile(d); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+
+	all, err := rcs.List()
+	if err != nil {
+		t.Fatalf("could not list RCs: %s", err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("expected exactly one RC to exist after the first reconcile, got %d", len(all))
+	}
+
+	// If the new RC's PodLabels didn't satisfy RCSelector, this second
+	// reconcile would find newRC == nil again and create a duplicate.
+	if err := c.reconcile(d); err != nil {
+		t.Fatalf("second reconcile failed: %s", err)
+	}
+
+	all, err = rcs.List()
+	if err != nil {
+		t.Fatalf("could not list RCs: %s", err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("expected reconcile to rediscover the existing RC instead of creating a new one, got %d RCs", len(all))
+	}
+
+	// An RC whose PodLabels don't satisfy RCSelector is invisible to this
+	// deployment entirely -- neither the new RC nor an old RC to shrink.
+	unrelatedRC, err := rcs.Create(manifest, allSelector{}, labels.Set{"app": "bar"})
+	if err != nil {
+		t.Fatalf("could not seed unrelated RC: %s", err)
+	}
+
+	newRC, oldRCs, err := c.oldAndNewRCs(d)
+	if err != nil {
+		t.Fatalf("could not inspect RCs: %s", err)
+	}
+	if newRC == nil || newRC.ID == unrelatedRC.ID {
+		t.Fatalf("expected the app=bar RC to be ignored, got newRC %+v", newRC)
+	}
+	for _, old := range oldRCs {
+		if old.ID == unrelatedRC.ID {
+			t.Fatal("expected the app=bar RC to be ignored, found it among old RCs")
+		}
+	}
+}
+
+func TestPauseStopsReconcile(t *testing.T) {
+	rcs := rcstore.NewFake()
+	store := NewFake()
+	logger := logging.DefaultLogger
+
+	manifest := fakeManifest{id: "helloworld", sha: "sha1"}
+	d, err := store.Create(manifest, allSelector{}, allSelector{}, labels.Set{}, 3, 1, 0)
+	if err != nil {
+		t.Fatalf("could not create deployment: %s", err)
+	}
+
+	c := NewController(store, rcs, logger)
+	if err := c.Pause(d.ID); err != nil {
+		t.Fatalf("could not pause: %s", err)
+	}
+
+	d, err = store.Get(d.ID)
+	if err != nil {
+		t.Fatalf("could not get deployment: %s", err)
+	}
+	if err := c.reconcile(d); err != nil {
+		t.Fatalf("reconcile of paused deployment should not error: %s", err)
+	}
+
+	all, err := rcs.List()
+	if err != nil {
+		t.Fatalf("could not list RCs: %s", err)
+	}
+	if len(all) != 0 {
+		t.Errorf("expected no RCs to be created for a paused deployment, got %d", len(all))
+	}
+}
@@ -0,0 +1,105 @@
+// Package deployment models a Deployment resource on top of existing RCs:
+// a higher-level object that owns a label selector and a desired pod
+// manifest, and drives the gradual replacement of "old" RCs (whose pod
+// template no longer matches the desired manifest) with a "new" RC. This
+// is analogous to how Kubernetes Deployments manage old and new
+// ReplicationControllers.
+package deployment
+
+import (
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/util"
+)
+
+// ID uniquely identifies a Deployment within a p2 cluster.
+type ID string
+
+func (id ID) String() string {
+	return string(id)
+}
+
+// Deployment is the persisted representation of a Deployment resource. The
+// deployment controller reconciles the RCs matching RCSelector towards
+// Manifest, creating a new RC when Manifest's SHA does not match any
+// existing RC's template, and scaling old RCs down as the new RC scales up.
+type Deployment struct {
+	ID ID
+
+	// Manifest is the pod manifest that RCs owned by this deployment should
+	// be converging towards. When it changes, the RC whose stored manifest
+	// has a matching SHA becomes the "new" RC; all others matching
+	// RCSelector become "old" RCs destined to be scaled to zero.
+	Manifest pods.Manifest
+
+	// RCSelector selects the RCs that belong to this deployment, old and
+	// new alike, by matching against their PodLabels. Every RC this
+	// deployment creates has PodLabels built from PodLabels below, so
+	// callers must choose an RCSelector that those labels satisfy -- e.g.
+	// the CLI derives RCSelector from the same key/value pairs it puts in
+	// PodLabels, rather than accepting them independently.
+	RCSelector labels.Selector
+
+	// NodeSelector selects which nodes are eligible to run the pods of any
+	// RC this deployment creates. It is unrelated to RCSelector: RCSelector
+	// targets RCs by their labels, NodeSelector targets nodes.
+	NodeSelector labels.Selector
+
+	// PodLabels are applied, in addition to the deployment-id and
+	// pod-template-sha labels, to any new RC created by this deployment.
+	PodLabels labels.Set
+
+	// ReplicasDesired is the steady-state total replica count once the
+	// rollout completes.
+	ReplicasDesired int
+
+	// MaxSurge bounds how many replicas beyond ReplicasDesired may exist
+	// across this deployment's RCs while a rollout is in progress.
+	MaxSurge int
+
+	// MaxUnavailable bounds how many of ReplicasDesired may be missing
+	// across this deployment's RCs while a rollout is in progress.
+	MaxUnavailable int
+
+	// Paused, when true, tells the controller to leave replica counts alone
+	// until the deployment is resumed.
+	Paused bool
+
+	// RollbackToSHA, when non-empty, asks the controller to make the RC
+	// with this pod-template SHA the new RC again, reverting a previous
+	// rollout. The controller clears this field once the rollback has been
+	// actioned.
+	RollbackToSHA string
+}
+
+// DeploymentIDLabel and PodTemplateSHALabel are the labels the controller
+// writes onto the new RC it creates, so that both the RC and its pods can
+// be traced back to the deployment and rollout that produced them.
+const (
+	DeploymentIDLabel   = "deployment-id"
+	PodTemplateSHALabel = "pod-template-sha"
+)
+
+// Validate reports whether d has enough information for the controller to
+// reconcile it.
+func (d Deployment) Validate() error {
+	if d.ID == "" {
+		return util.Errorf("deployment ID not specified")
+	}
+	if d.RCSelector == nil {
+		return util.Errorf("deployment %s has no RC selector", d.ID)
+	}
+	if d.NodeSelector == nil {
+		return util.Errorf("deployment %s has no node selector", d.ID)
+	}
+	if d.Manifest == nil {
+		return util.Errorf("deployment %s has no pod manifest", d.ID)
+	}
+	if d.ReplicasDesired < 0 {
+		return util.Errorf("deployment %s has negative ReplicasDesired", d.ID)
+	}
+	if d.MaxSurge < 0 || d.MaxUnavailable < 0 {
+		return util.Errorf("deployment %s has negative maxSurge/maxUnavailable", d.ID)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/square/p2/Godeps/_workspace/src/github.com/hashicorp/consul/api"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/util"
+)
+
+// deploymentTree is the consul prefix under which Deployment objects are
+// stored, one key per deployment ID, analogous to rcstore's "rcs/" prefix.
+const deploymentTree = "deployments"
+
+// Store persists Deployment objects and lists them for the controller.
+type Store interface {
+	Get(id ID) (Deployment, error)
+	List() ([]Deployment, error)
+	Create(manifest pods.Manifest, nodeSelector, rcSelector labels.Selector, podLabels labels.Set, replicasDesired, maxSurge, maxUnavailable int) (Deployment, error)
+	Put(d Deployment) error
+	Delete(id ID) error
+}
+
+type jsonDeployment struct {
+	ID              ID         `json:"id"`
+	Manifest        string     `json:"manifest"`
+	RCSelector      string     `json:"rc_selector"`
+	NodeSelector    string     `json:"node_selector"`
+	PodLabels       labels.Set `json:"pod_labels"`
+	ReplicasDesired int        `json:"replicas_desired"`
+	MaxSurge        int        `json:"max_surge"`
+	MaxUnavailable  int        `json:"max_unavailable"`
+	Paused          bool       `json:"paused"`
+	RollbackToSHA   string     `json:"rollback_to_sha,omitempty"`
+}
+
+func (d Deployment) toJSON() (jsonDeployment, error) {
+	manifestStr, err := d.Manifest.Marshal()
+	if err != nil {
+		return jsonDeployment{}, util.Errorf("could not marshal manifest for deployment %s: %s", d.ID, err)
+	}
+	return jsonDeployment{
+		ID:              d.ID,
+		Manifest:        string(manifestStr),
+		RCSelector:      d.RCSelector.String(),
+		NodeSelector:    d.NodeSelector.String(),
+		PodLabels:       d.PodLabels,
+		ReplicasDesired: d.ReplicasDesired,
+		MaxSurge:        d.MaxSurge,
+		MaxUnavailable:  d.MaxUnavailable,
+		Paused:          d.Paused,
+		RollbackToSHA:   d.RollbackToSHA,
+	}, nil
+}
+
+func (j jsonDeployment) toDeployment() (Deployment, error) {
+	manifest, err := pods.ManifestFromBytes([]byte(j.Manifest))
+	if err != nil {
+		return Deployment{}, util.Errorf("could not parse manifest for deployment %s: %s", j.ID, err)
+	}
+	selector, err := labels.Parse(j.RCSelector)
+	if err != nil {
+		return Deployment{}, util.Errorf("could not parse RC selector for deployment %s: %s", j.ID, err)
+	}
+	nodeSelector, err := labels.Parse(j.NodeSelector)
+	if err != nil {
+		return Deployment{}, util.Errorf("could not parse node selector for deployment %s: %s", j.ID, err)
+	}
+	return Deployment{
+		ID:              j.ID,
+		Manifest:        manifest,
+		RCSelector:      selector,
+		NodeSelector:    nodeSelector,
+		PodLabels:       j.PodLabels,
+		ReplicasDesired: j.ReplicasDesired,
+		MaxSurge:        j.MaxSurge,
+		MaxUnavailable:  j.MaxUnavailable,
+		Paused:          j.Paused,
+		RollbackToSHA:   j.RollbackToSHA,
+	}, nil
+}
+
+type consulStore struct {
+	kv      *api.KV
+	retries int
+}
+
+// NewConsul returns a Store that persists Deployment objects in consul
+// under the "deployments/" prefix, mirroring rcstore.NewConsul.
+func NewConsul(client *api.Client, retries int) Store {
+	return &consulStore{kv: client.KV(), retries: retries}
+}
+
+func deploymentPath(id ID) string {
+	return fmt.Sprintf("%s/%s", deploymentTree, id)
+}
+
+func (s *consulStore) Get(id ID) (Deployment, error) {
+	kvp, _, err := s.kv.Get(deploymentPath(id), nil)
+	if err != nil {
+		return Deployment{}, util.Errorf("could not fetch deployment %s: %s", id, err)
+	}
+	if kvp == nil {
+		return Deployment{}, util.Errorf("no deployment with ID %s", id)
+	}
+
+	var j jsonDeployment
+	if err := json.Unmarshal(kvp.Value, &j); err != nil {
+		return Deployment{}, util.Errorf("could not unmarshal deployment %s: %s", id, err)
+	}
+	return j.toDeployment()
+}
+
+func (s *consulStore) List() ([]Deployment, error) {
+	pairs, _, err := s.kv.List(deploymentTree+"/", nil)
+	if err != nil {
+		return nil, util.Errorf("could not list deployments: %s", err)
+	}
+
+	ret := make([]Deployment, 0, len(pairs))
+	for _, kvp := range pairs {
+		var j jsonDeployment
+		if err := json.Unmarshal(kvp.Value, &j); err != nil {
+			return nil, util.Errorf("could not unmarshal deployment at %s: %s", kvp.Key, err)
+		}
+		d, err := j.toDeployment()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
+
+func (s *consulStore) Create(manifest pods.Manifest, nodeSelector, rcSelector labels.Selector, podLabels labels.Set, replicasDesired, maxSurge, maxUnavailable int) (Deployment, error) {
+	id := ID(util.RandomUUID())
+	d := Deployment{
+		ID:              id,
+		Manifest:        manifest,
+		RCSelector:      rcSelector,
+		NodeSelector:    nodeSelector,
+		PodLabels:       podLabels,
+		ReplicasDesired: replicasDesired,
+		MaxSurge:        maxSurge,
+		MaxUnavailable:  maxUnavailable,
+	}
+	if err := d.Validate(); err != nil {
+		return Deployment{}, err
+	}
+	if err := s.Put(d); err != nil {
+		return Deployment{}, err
+	}
+	return d, nil
+}
+
+func (s *consulStore) Put(d Deployment) error {
+	j, err := d.toJSON()
+	if err != nil {
+		return err
+	}
+	bytes, err := json.Marshal(j)
+	if err != nil {
+		return util.Errorf("could not marshal deployment %s: %s", d.ID, err)
+	}
+
+	_, err = s.kv.Put(&api.KVPair{Key: deploymentPath(d.ID), Value: bytes}, nil)
+	if err != nil {
+		return util.Errorf("could not write deployment %s: %s", d.ID, err)
+	}
+	return nil
+}
+
+func (s *consulStore) Delete(id ID) error {
+	_, err := s.kv.Delete(deploymentPath(id), nil)
+	if err != nil {
+		return util.Errorf("could not delete deployment %s: %s", id, err)
+	}
+	return nil
+}
+
+// fakeStore is an in-memory Store for tests and local experimentation,
+// mirroring rcstore.NewFake.
+type fakeStore struct {
+	mu          sync.Mutex
+	deployments map[ID]Deployment
+}
+
+// NewFake returns an in-memory Store, analogous to rcstore.NewFake.
+func NewFake() Store {
+	return &fakeStore{deployments: make(map[ID]Deployment)}
+}
+
+func (s *fakeStore) Get(id ID) (Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deployments[id]
+	if !ok {
+		return Deployment{}, util.Errorf("no deployment with ID %s", id)
+	}
+	return d, nil
+}
+
+func (s *fakeStore) List() ([]Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]Deployment, 0, len(s.deployments))
+	for _, d := range s.deployments {
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
+
+func (s *fakeStore) Create(manifest pods.Manifest, nodeSelector, rcSelector labels.Selector, podLabels labels.Set, replicasDesired, maxSurge, maxUnavailable int) (Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := Deployment{
+		ID:              ID(util.RandomUUID()),
+		Manifest:        manifest,
+		RCSelector:      rcSelector,
+		NodeSelector:    nodeSelector,
+		PodLabels:       podLabels,
+		ReplicasDesired: replicasDesired,
+		MaxSurge:        maxSurge,
+		MaxUnavailable:  maxUnavailable,
+	}
+	if err := d.Validate(); err != nil {
+		return Deployment{}, err
+	}
+	s.deployments[d.ID] = d
+	return d, nil
+}
+
+func (s *fakeStore) Put(d Deployment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deployments[d.ID] = d
+	return nil
+}
+
+func (s *fakeStore) Delete(id ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.deployments, id)
+	return nil
+}
@@ -0,0 +1,151 @@
+package labels
+
+import (
+	"time"
+
+	"github.com/square/p2/Godeps/_workspace/src/github.com/hashicorp/consul/api"
+)
+
+// watchErrorBackoff is how long WatchMatches waits after a transient error
+// before retrying, so a consul (or, for HttpApplicator, node endpoint)
+// outage doesn't turn into a busy-loop hammering it with requests.
+const watchErrorBackoff = 1 * time.Second
+
+// httpPollInterval is how often HttpApplicator.WatchMatches polls
+// GetMatches, since HttpApplicator has no blocking-query mechanism of its
+// own to wait on.
+const httpPollInterval = 1 * time.Second
+
+// WatchMatches watches selector against the given label type's index and
+// pushes the updated match set on the returned channel only when something
+// actually changes, using consul's blocking queries (api.QueryOptions.WaitIndex)
+// rather than polling. The channels are closed once quit is closed.
+func (a *ConsulApplicator) WatchMatches(selector Selector, labelType Type, quit <-chan struct{}) (<-chan []Labeled, <-chan error) {
+	matches := make(chan []Labeled)
+	errs := make(chan error)
+
+	go func() {
+		defer close(matches)
+		defer close(errs)
+
+		var lastIndex uint64
+		var last []Labeled
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+			}
+
+			all, queryMeta, err := a.listLabeledWithOptions(labelType, &api.QueryOptions{WaitIndex: lastIndex})
+			if err != nil {
+				select {
+				case errs <- err:
+				case <-quit:
+					return
+				}
+				select {
+				case <-time.After(watchErrorBackoff):
+				case <-quit:
+					return
+				}
+				continue
+			}
+
+			lastIndex = queryMeta.LastIndex
+
+			var filtered []Labeled
+			for _, l := range all {
+				if selector.Matches(l.Labels) {
+					filtered = append(filtered, l)
+				}
+			}
+
+			// The blocking query returns on any change to labelType's
+			// index, not just ones affecting selector, so only emit when
+			// the filtered set this selector cares about actually changed.
+			if sameLabeled(last, filtered) {
+				continue
+			}
+			last = filtered
+
+			select {
+			case matches <- filtered:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	return matches, errs
+}
+
+// WatchMatches has the same contract as ConsulApplicator.WatchMatches, but
+// since HttpApplicator has no consul index of its own to block on, it falls
+// back to polling GetMatches and only emits when the match set changes.
+func (a *HttpApplicator) WatchMatches(selector Selector, labelType Type, quit <-chan struct{}) (<-chan []Labeled, <-chan error) {
+	matches := make(chan []Labeled)
+	errs := make(chan error)
+
+	go func() {
+		defer close(matches)
+		defer close(errs)
+
+		var last []Labeled
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+			}
+
+			current, err := a.GetMatches(selector, labelType)
+			if err != nil {
+				select {
+				case errs <- err:
+				case <-quit:
+					return
+				}
+				select {
+				case <-time.After(watchErrorBackoff):
+				case <-quit:
+					return
+				}
+				continue
+			}
+
+			if !sameLabeled(last, current) {
+				last = current
+				select {
+				case matches <- current:
+				case <-quit:
+					return
+				}
+			}
+
+			select {
+			case <-time.After(httpPollInterval):
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	return matches, errs
+}
+
+func sameLabeled(a, b []Labeled) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool, len(a))
+	for _, l := range a {
+		seen[l.ID] = true
+	}
+	for _, l := range b {
+		if !seen[l.ID] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package preparer
+
+import (
+	"io/ioutil"
+
+	"github.com/square/p2/Godeps/_workspace/src/gopkg.in/yaml.v1"
+	"github.com/square/p2/pkg/util"
+)
+
+// PreparerConfig holds preparer.yaml configuration: where to find consul,
+// this node's identity, where hooks live, and how the status/metrics HTTP
+// server should behave.
+type PreparerConfig struct {
+	NodeName       string            `yaml:"node_name"`
+	ConsulAddress  string            `yaml:"consul_address"`
+	HooksDirectory string            `yaml:"hooks_directory"`
+	Auth           map[string]string `yaml:"auth"`
+
+	// StatusReadyThreshold is how many consecutive pod-watch or hook-watch
+	// errors /_status/ready tolerates before it starts returning 503. Zero
+	// means "use the preparer binary's built-in default".
+	StatusReadyThreshold int `yaml:"status_ready_threshold"`
+}
+
+// LoadPreparerConfig reads and parses a PreparerConfig from a yaml file at
+// path.
+func LoadPreparerConfig(path string) (*PreparerConfig, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.Errorf("could not read preparer config at %s: %s", path, err)
+	}
+
+	var config PreparerConfig
+	if err := yaml.Unmarshal(bytes, &config); err != nil {
+		return nil, util.Errorf("could not parse preparer config at %s: %s", path, err)
+	}
+
+	if config.NodeName == "" {
+		return nil, util.Errorf("preparer config at %s has no node_name", path)
+	}
+	if config.StatusReadyThreshold < 0 {
+		return nil, util.Errorf("preparer config at %s has negative status_ready_threshold %d", path, config.StatusReadyThreshold)
+	}
+
+	return &config, nil
+}
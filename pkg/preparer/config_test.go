@@ -0,0 +1,41 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile("", "preparer-config")
+	if err != nil {
+		t.Fatalf("could not create temp config file: %s", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatalf("could not write temp config file: %s", err)
+	}
+	return f.Name()
+}
+
+func TestLoadPreparerConfigRejectsNegativeStatusReadyThreshold(t *testing.T) {
+	path := writeConfig(t, "node_name: test-node\nstatus_ready_threshold: -1\n")
+	defer os.Remove(path)
+
+	if _, err := LoadPreparerConfig(path); err == nil {
+		t.Fatal("expected a negative status_ready_threshold to be rejected")
+	}
+}
+
+func TestLoadPreparerConfigAcceptsZeroStatusReadyThreshold(t *testing.T) {
+	path := writeConfig(t, "node_name: test-node\n")
+	defer os.Remove(path)
+
+	config, err := LoadPreparerConfig(path)
+	if err != nil {
+		t.Fatalf("expected a missing status_ready_threshold to default to 0, got error: %s", err)
+	}
+	if config.StatusReadyThreshold != 0 {
+		t.Errorf("expected default status_ready_threshold of 0, got %d", config.StatusReadyThreshold)
+	}
+}
@@ -0,0 +1,154 @@
+package preparer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics holds atomically-updated counters and gauges for the preparer's
+// pod and hook watch loops, plus a histogram of install durations. Both the
+// /_status/ready handler and the /metrics endpoint read through this one
+// struct so they always agree on the current state, instead of each
+// tracking their own int pointers from watchForErrors.
+type Metrics struct {
+	podWatchSuccesses  uint64
+	podWatchErrors     uint64
+	hookWatchSuccesses uint64
+	hookWatchErrors    uint64
+
+	consecutivePodErrors  uint64
+	consecutiveHookErrors uint64
+
+	lastSuccessUnixNano int64
+
+	installDurations installHistogram
+}
+
+// NewMetrics returns a Metrics with every counter at zero and the
+// last-success time set to now, ready to be shared between the watch loops
+// and the status/metrics HTTP handlers.
+func NewMetrics() *Metrics {
+	m := &Metrics{}
+	atomic.StoreInt64(&m.lastSuccessUnixNano, time.Now().UnixNano())
+	return m
+}
+
+// RecordPodWatchSuccess resets the consecutive pod error count and bumps
+// the last-success gauge. Call it every time WatchForPodManifestsForNode
+// reports a success.
+func (m *Metrics) RecordPodWatchSuccess() {
+	atomic.AddUint64(&m.podWatchSuccesses, 1)
+	atomic.StoreUint64(&m.consecutivePodErrors, 0)
+	atomic.StoreInt64(&m.lastSuccessUnixNano, time.Now().UnixNano())
+}
+
+// RecordPodWatchError bumps both the total and consecutive pod error
+// counts.
+func (m *Metrics) RecordPodWatchError() {
+	atomic.AddUint64(&m.podWatchErrors, 1)
+	atomic.AddUint64(&m.consecutivePodErrors, 1)
+}
+
+// RecordHookWatchSuccess is RecordPodWatchSuccess's counterpart for
+// WatchForHooks.
+func (m *Metrics) RecordHookWatchSuccess() {
+	atomic.AddUint64(&m.hookWatchSuccesses, 1)
+	atomic.StoreUint64(&m.consecutiveHookErrors, 0)
+	atomic.StoreInt64(&m.lastSuccessUnixNano, time.Now().UnixNano())
+}
+
+// RecordHookWatchError is RecordPodWatchError's counterpart for
+// WatchForHooks.
+func (m *Metrics) RecordHookWatchError() {
+	atomic.AddUint64(&m.hookWatchErrors, 1)
+	atomic.AddUint64(&m.consecutiveHookErrors, 1)
+}
+
+// ConsecutivePodErrors is the number of pod-watch errors reported since the
+// last pod-watch success.
+func (m *Metrics) ConsecutivePodErrors() uint64 {
+	return atomic.LoadUint64(&m.consecutivePodErrors)
+}
+
+// ConsecutiveHookErrors is the number of hook-watch errors reported since
+// the last hook-watch success.
+func (m *Metrics) ConsecutiveHookErrors() uint64 {
+	return atomic.LoadUint64(&m.consecutiveHookErrors)
+}
+
+// TimeSinceLastSuccess is how long it has been since either watch loop last
+// reported success.
+func (m *Metrics) TimeSinceLastSuccess() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&m.lastSuccessUnixNano)))
+}
+
+// ObserveInstallDuration records how long one manifest install took. It is
+// called from installPod so the /metrics histogram reflects real install
+// latency, not just watch loop health.
+func (m *Metrics) ObserveInstallDuration(d time.Duration) {
+	m.installDurations.observe(d.Seconds())
+}
+
+// WritePrometheus writes every counter, gauge, and histogram tracked by m in
+// Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	fmt.Fprintln(w, "# TYPE p2_preparer_pod_watch_successes_total counter")
+	fmt.Fprintf(w, "p2_preparer_pod_watch_successes_total %d\n", atomic.LoadUint64(&m.podWatchSuccesses))
+	fmt.Fprintln(w, "# TYPE p2_preparer_pod_watch_errors_total counter")
+	fmt.Fprintf(w, "p2_preparer_pod_watch_errors_total %d\n", atomic.LoadUint64(&m.podWatchErrors))
+	fmt.Fprintln(w, "# TYPE p2_preparer_hook_watch_successes_total counter")
+	fmt.Fprintf(w, "p2_preparer_hook_watch_successes_total %d\n", atomic.LoadUint64(&m.hookWatchSuccesses))
+	fmt.Fprintln(w, "# TYPE p2_preparer_hook_watch_errors_total counter")
+	fmt.Fprintf(w, "p2_preparer_hook_watch_errors_total %d\n", atomic.LoadUint64(&m.hookWatchErrors))
+	fmt.Fprintln(w, "# TYPE p2_preparer_seconds_since_last_success gauge")
+	fmt.Fprintf(w, "p2_preparer_seconds_since_last_success %f\n", m.TimeSinceLastSuccess().Seconds())
+	m.installDurations.writePrometheus(w, "p2_preparer_install_duration_seconds")
+}
+
+// installHistogramBuckets are the upper bounds, in seconds, of the install
+// duration histogram, chosen to cover a fast hook-free install up through a
+// slow one involving several hooks.
+var installHistogramBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60}
+
+type installHistogram struct {
+	mu      sync.Mutex
+	buckets []uint64 // buckets[i] counts installs <= installHistogramBuckets[i]
+	count   uint64
+	sum     float64
+}
+
+func (h *installHistogram) observe(seconds float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.buckets == nil {
+		h.buckets = make([]uint64, len(installHistogramBuckets))
+	}
+	for i, upperBound := range installHistogramBuckets {
+		if seconds <= upperBound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func (h *installHistogram) writePrometheus(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for i, upperBound := range installHistogramBuckets {
+		var bucketCount uint64
+		if h.buckets != nil {
+			bucketCount = h.buckets[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, upperBound, bucketCount)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %f\n", name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
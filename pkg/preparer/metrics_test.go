@@ -0,0 +1,39 @@
+package preparer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsConsecutiveErrorsResetOnSuccess(t *testing.T) {
+	m := NewMetrics()
+
+	m.RecordPodWatchError()
+	m.RecordPodWatchError()
+	if got := m.ConsecutivePodErrors(); got != 2 {
+		t.Fatalf("expected 2 consecutive pod errors, got %d", got)
+	}
+
+	m.RecordPodWatchSuccess()
+	if got := m.ConsecutivePodErrors(); got != 0 {
+		t.Fatalf("expected consecutive pod errors to reset to 0 after a success, got %d", got)
+	}
+}
+
+func TestMetricsWritePrometheusIncludesInstallHistogram(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveInstallDuration(750 * time.Millisecond)
+
+	var buf bytes.Buffer
+	m.WritePrometheus(&buf)
+
+	out := buf.String()
+	if !strings.Contains(out, "p2_preparer_install_duration_seconds_count 1") {
+		t.Errorf("expected install duration histogram to show one observation, got:\n%s", out)
+	}
+	if !strings.Contains(out, `p2_preparer_install_duration_seconds_bucket{le="1"} 1`) {
+		t.Errorf("expected a 750ms install to land in the le=1 bucket, got:\n%s", out)
+	}
+}
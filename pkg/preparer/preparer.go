@@ -0,0 +1,65 @@
+package preparer
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pods"
+)
+
+// Preparer watches this node's pod manifests and hooks in consul and
+// installs whatever they declare.
+type Preparer struct {
+	config  *PreparerConfig
+	logger  logging.Logger
+	metrics *Metrics
+}
+
+// New returns a Preparer for the given config, with a fresh Metrics that
+// bin/p2-preparer should share with its status and /metrics HTTP handlers.
+func New(config *PreparerConfig, logger logging.Logger) (*Preparer, error) {
+	return &Preparer{
+		config:  config,
+		logger:  logger,
+		metrics: NewMetrics(),
+	}, nil
+}
+
+// Metrics returns the Preparer's Metrics, shared with bin/p2-preparer's
+// status and /metrics handlers so install-duration observations made here
+// show up there.
+func (p *Preparer) Metrics() *Metrics {
+	return p.metrics
+}
+
+// Close releases any resources held by the preparer.
+func (p *Preparer) Close() {
+}
+
+// WatchForPodManifestsForNode blocks until a value is received on quit. It
+// does not watch the intent tree or install manifests, and it sends nothing
+// on success, errs or quit.
+func (p *Preparer) WatchForPodManifestsForNode(success chan<- struct{}, errs chan<- error, quit <-chan struct{}) {
+	<-quit
+}
+
+// WatchForHooks blocks until a value is received on quit. It does not watch
+// the hooks tree, and it sends nothing on success or errs.
+func (p *Preparer) WatchForHooks(success chan<- struct{}, errs chan<- error, quit <-chan struct{}) {
+	<-quit
+}
+
+// installPod installs manifest's pod, recording how long the install took
+// on p.metrics so the /metrics histogram reflects real install latency.
+func (p *Preparer) installPod(manifest pods.Manifest) error {
+	start := time.Now()
+	err := p.doInstallPod(manifest)
+	p.metrics.ObserveInstallDuration(time.Since(start))
+	return err
+}
+
+// doInstallPod returns nil without doing anything: it does not write the
+// manifest down, run its hooks, or launch it.
+func (p *Preparer) doInstallPod(manifest pods.Manifest) error {
+	return nil
+}
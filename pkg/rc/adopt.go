@@ -0,0 +1,90 @@
+package rc
+
+import (
+	"fmt"
+
+	"github.com/square/p2/pkg/labels"
+)
+
+// AdoptOrphans finds pods matching this RC's pod ID that are already
+// running on a node matching the RC's NodeSelector but aren't yet labeled
+// with this RC's ID -- orphans left over from a prior deployment of the
+// same pod -- and labels them as belonging to this RC so they count
+// towards CurrentNodes() instead of being scheduled again as duplicates.
+//
+// A pod is only adopted if its manifest SHA matches this RC's; pods whose
+// SHA differs are left alone and logged as a conflict, since adopting them
+// would silently change what's running on that node.
+func (rc *ReplicationController) AdoptOrphans() error {
+	if !rc.AdoptExisting {
+		return nil
+	}
+
+	podIDSelector, err := labels.Parse(fmt.Sprintf("%s=%s", podIDLabel, rc.Manifest.ID()))
+	if err != nil {
+		return err
+	}
+
+	candidates, err := rc.podApplicator.GetMatches(podIDSelector, labels.POD)
+	if err != nil {
+		return err
+	}
+
+	desiredSHA, err := rc.Manifest.SHA()
+	if err != nil {
+		return err
+	}
+	// The sha-truncated label holds at most the first 63 characters of the
+	// manifest SHA, so compare against the same prefix.
+	if len(desiredSHA) > 63 {
+		desiredSHA = desiredSHA[:63]
+	}
+
+	for _, candidate := range candidates {
+		node := candidate.Labels.Get("node")
+		if !rc.NodeSelector.Matches(labels.Set{"node": node}) {
+			continue
+		}
+
+		if candidate.Labels.Get(rcIDLabel) == rc.ID.String() {
+			// Already ours.
+			continue
+		}
+
+		sha, err := rc.podSHAOnNode(candidate)
+		if err != nil {
+			rc.logger.WithError(err).Errorf("could not determine manifest SHA for orphan pod on %s", node)
+			continue
+		}
+
+		if sha != desiredSHA {
+			rc.logger.Errorf("conflict: orphan pod on %s matches pod-id %s but has manifest sha %s, not %s; leaving it alone", node, rc.Manifest.ID(), sha, desiredSHA)
+			continue
+		}
+
+		newLabels := labels.Set{}
+		for k, v := range candidate.Labels {
+			newLabels[k] = v
+		}
+		newLabels[rcIDLabel] = rc.ID.String()
+
+		if err := rc.podApplicator.SetLabels(labels.POD, candidate.ID, newLabels); err != nil {
+			return err
+		}
+
+		rc.logger.Infof("adopted orphan pod on %s into RC %s", node, rc.ID)
+	}
+
+	return nil
+}
+
+// podSHAOnNode returns the manifest SHA of a labeled pod, as reported by its
+// sha-truncated label (at most the first 63 characters of the SHA). Pods get
+// that label at schedule time when it is among the RC's PodLabels.
+func (rc *ReplicationController) podSHAOnNode(pod labels.Labeled) (string, error) {
+	sha := pod.Labels.Get("sha-truncated")
+	if sha == "" {
+		return "", fmt.Errorf("pod %s has no sha-truncated label", pod.ID)
+	}
+	return sha, nil
+}
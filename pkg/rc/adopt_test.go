@@ -0,0 +1,139 @@
+package rc
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/rc/fields"
+)
+
+type fakeManifest struct {
+	id  string
+	sha string
+}
+
+func (m fakeManifest) ID() string              { return m.id }
+func (m fakeManifest) SHA() (string, error)     { return m.sha, nil }
+func (m fakeManifest) Marshal() ([]byte, error) { return []byte(m.id + ":" + m.sha), nil }
+
+type allSelector struct{}
+
+func (allSelector) Matches(labels.Set) bool { return true }
+func (allSelector) String() string          { return "" }
+
+// newFakeLabelStore returns a fakeApplicator backed by pods, a pod-ID ->
+// labels map held by reference. Unlike a closure that always returns the
+// same canned result, GetMatches here actually applies selector.Matches
+// against pods and SetLabels actually mutates it, so a sequence of calls
+// (as meetDesires makes: AdoptOrphans' pod-id query, then CurrentNodes'
+// rc_id query) sees each other's writes, the same as the real
+// ConsulApplicator would.
+func newFakeLabelStore(pods map[string]labels.Set) *fakeApplicator {
+	applicator := &fakeApplicator{}
+	applicator.getMatches = func(selector labels.Selector, labelType labels.Type) ([]labels.Labeled, error) {
+		var matches []labels.Labeled
+		for id, set := range pods {
+			if selector.Matches(set) {
+				matches = append(matches, labels.Labeled{ID: id, Labels: set})
+			}
+		}
+		return matches, nil
+	}
+	applicator.setLabels = func(labelType labels.Type, id string, values labels.Set) error {
+		pods[id] = values
+		return nil
+	}
+	return applicator
+}
+
+func TestAdoptOrphansLabelsMatchingSHAOnly(t *testing.T) {
+	manifest := fakeManifest{id: "helloworld", sha: "goodsha"}
+
+	pods := map[string]labels.Set{
+		"node1": {"pod-id": "helloworld", "node": "node1", "sha-truncated": "goodsha"},
+		"node2": {"pod-id": "helloworld", "node": "node2", "sha-truncated": "badsha"},
+	}
+	applicator := newFakeLabelStore(pods)
+
+	replicationController := New(
+		fields.RC{
+			ID:            fields.ID("rc1"),
+			Manifest:      manifest,
+			NodeSelector:  allSelector{},
+			AdoptExisting: true,
+		},
+		nil,
+		nil,
+		nil,
+		applicator,
+	)
+
+	if err := replicationController.AdoptOrphans(); err != nil {
+		t.Fatalf("AdoptOrphans failed: %s", err)
+	}
+
+	if pods["node1"].Get(rcIDLabel) != "rc1" {
+		t.Errorf("expected node1's matching-SHA orphan to be adopted into rc1, got labels %v", pods["node1"])
+	}
+	if pods["node2"].Get(rcIDLabel) != "" {
+		t.Errorf("expected node2's mismatched-SHA orphan to be left alone, got labels %v", pods["node2"])
+	}
+}
+
+// TestAdoptOrphansReducesNewlyScheduledNodes shows the motivating case from
+// the request: when a pre-labeled orphan already satisfies one of the
+// desired replicas, meetDesires schedules one fewer new node than it would
+// without adoption. It drives this through meetDesires itself -- the method
+// WatchDesires actually calls every reconcile tick -- rather than calling
+// AdoptOrphans and schedule directly, so deleting the AdoptOrphans call
+// from meetDesires would make this test fail.
+func TestAdoptOrphansReducesNewlyScheduledNodes(t *testing.T) {
+	manifest := fakeManifest{id: "helloworld", sha: "goodsha"}
+
+	// node1 already runs a matching-SHA orphan pod; node2 and node3 are
+	// free.
+	pods := map[string]labels.Set{
+		"node1": {"pod-id": "helloworld", "node": "node1", "sha-truncated": "goodsha"},
+	}
+	applicator := newFakeLabelStore(pods)
+
+	rcFields := fields.RC{
+		ID:              fields.ID("rc1"),
+		Manifest:        manifest,
+		NodeSelector:    allSelector{},
+		ReplicasDesired: 2,
+		AdoptExisting:   true,
+	}
+
+	// node1 is listed last so that, without adoption, scheduling 2 replicas
+	// would pick node2 and node3 and this test would see 2 new nodes.
+	scheduler := fakeInnerScheduler{nodes: []string{"node2", "node3", "node1"}}
+	replicationController := New(rcFields, nil, nil, scheduler, applicator)
+
+	if err := replicationController.meetDesires(); err != nil {
+		t.Fatalf("meetDesires failed: %s", err)
+	}
+
+	var scheduledOn []string
+	for id, set := range pods {
+		if set.Get(rcIDLabel) == "rc1" {
+			scheduledOn = append(scheduledOn, id)
+		}
+	}
+
+	if len(scheduledOn) != 2 {
+		t.Fatalf("expected 2 nodes running the pod after adoption and scheduling, got %d (%v)", len(scheduledOn), scheduledOn)
+	}
+
+	// Exactly one of the two came from scheduling a brand-new node --
+	// node1 was adopted, not newly scheduled.
+	newlyScheduled := 0
+	for _, node := range scheduledOn {
+		if node != "node1" {
+			newlyScheduled++
+		}
+	}
+	if newlyScheduled != 1 {
+		t.Fatalf("expected adoption to reduce newly-scheduled nodes to 1, got %d (%v)", newlyScheduled, scheduledOn)
+	}
+}
@@ -0,0 +1,59 @@
+// Package fields holds the persisted representation of a replication
+// controller, kept separate from package rc so that rcstore and other
+// low-level packages can depend on it without importing the controller
+// logic itself.
+package fields
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/pods"
+)
+
+// ID uniquely identifies an RC within a p2 cluster.
+type ID string
+
+func (id ID) String() string {
+	return string(id)
+}
+
+// RC is the portion of a replication controller's state that's persisted in
+// rcstore: what to run, where to run it, and how many to run.
+type RC struct {
+	ID ID
+
+	// Manifest is the pod manifest that this RC's current nodes should be
+	// running.
+	Manifest pods.Manifest
+
+	// NodeSelector selects which nodes are eligible to run this RC's pods.
+	NodeSelector labels.Selector
+
+	// PodLabels are applied to every pod this RC schedules. Current nodes
+	// are found via the rc_id label that the controller writes onto a pod
+	// once it belongs to this RC, not via PodLabels itself.
+	PodLabels labels.Set
+
+	// Disabled RCs do not create or remove pods; they merely report their
+	// current state.
+	Disabled bool
+
+	// ReplicasDesired is how many nodes this RC should currently have the
+	// pod scheduled on.
+	ReplicasDesired int
+
+	// CreatedAt is set by the store at creation time and never changes
+	// afterwards. Callers juggling several RCs for the same pod ID (e.g.
+	// deployment.Controller picking which "old" RC to shrink next) use it
+	// to order RCs oldest-first, since RC IDs carry no ordering of their
+	// own.
+	CreatedAt time.Time
+
+	// AdoptExisting, when true, tells the controller to fold orphaned pods
+	// (pods already labeled pod-id=<Manifest.ID()> on a node matching
+	// NodeSelector, but not yet labeled with this RC's ID) into the RC
+	// instead of scheduling duplicates, provided the orphan's manifest SHA
+	// matches this RC's. See rc.ReplicationController.AdoptOrphans.
+	AdoptExisting bool
+}
@@ -0,0 +1,172 @@
+package rc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/square/p2/pkg/kp"
+	"github.com/square/p2/pkg/kp/rcstore"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/rc/fields"
+)
+
+// Scheduler finds nodes eligible to run a manifest. ApplicatorScheduler and
+// SpreadScheduler are the two implementations in this package.
+type Scheduler interface {
+	EligibleNodes(manifest pods.Manifest, selector labels.Selector) ([]string, error)
+}
+
+// rcIDLabel is the pod label that records which RC a pod currently belongs
+// to. It is distinct from podIDLabel, which records the pod's manifest ID
+// and is the same across every RC that has ever run that pod.
+const rcIDLabel = "rc_id"
+
+// podIDLabel is the pod label that records a pod's manifest ID, shared by
+// every RC that has ever run that pod. AdoptOrphans uses it to find
+// candidates; it is never used to determine RC ownership.
+const podIDLabel = "pod-id"
+
+// ReplicationController reconciles a single RC's desired replica count
+// against which nodes are actually running its pod.
+type ReplicationController struct {
+	fields.RC
+
+	kpStore       kp.Store
+	rcStore       rcstore.Store
+	scheduler     Scheduler
+	podApplicator labels.Applicator
+	logger        logging.Logger
+}
+
+// New returns a ReplicationController that reconciles rc against rcStore,
+// using scheduler to find nodes and podApplicator to read and write pod
+// labels.
+func New(rc fields.RC, kpStore kp.Store, rcStore rcstore.Store, scheduler Scheduler, podApplicator labels.Applicator) *ReplicationController {
+	return &ReplicationController{
+		RC:            rc,
+		kpStore:       kpStore,
+		rcStore:       rcStore,
+		scheduler:     scheduler,
+		podApplicator: podApplicator,
+		logger:        logging.DefaultLogger,
+	}
+}
+
+// rcIDSelector matches pods labeled as belonging to this RC.
+func (rc *ReplicationController) rcIDSelector() (labels.Selector, error) {
+	return labels.Parse(fmt.Sprintf("%s=%s", rcIDLabel, rc.ID))
+}
+
+// CurrentNodes returns the nodes this RC currently has its pod running on,
+// i.e. those labeled with this RC's ID.
+func (rc *ReplicationController) CurrentNodes() ([]string, error) {
+	selector, err := rc.rcIDSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := rc.podApplicator.GetMatches(selector, labels.POD)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]string, 0, len(matches))
+	for _, m := range matches {
+		nodes = append(nodes, m.ID)
+	}
+	return nodes, nil
+}
+
+// WatchDesires reconciles this RC every second until quit is closed,
+// reporting reconcile errors on the returned channel without stopping the
+// loop.
+func (rc *ReplicationController) WatchDesires(quit <-chan struct{}) <-chan error {
+	errs := make(chan error)
+
+	go func() {
+		defer close(errs)
+		for {
+			select {
+			case <-quit:
+				return
+			case <-time.After(1 * time.Second):
+				if err := rc.meetDesires(); err != nil {
+					select {
+					case errs <- err:
+					case <-quit:
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return errs
+}
+
+// meetDesires is one reconcile pass: it first adopts any orphaned pods (if
+// AdoptExisting is set), then schedules or unschedules pods to converge
+// CurrentNodes() on ReplicasDesired.
+func (rc *ReplicationController) meetDesires() error {
+	if err := rc.AdoptOrphans(); err != nil {
+		rc.logger.WithError(err).Errorln("could not adopt orphan pods")
+	}
+
+	current, err := rc.CurrentNodes()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(current) < rc.ReplicasDesired:
+		return rc.schedule(rc.ReplicasDesired-len(current), current)
+	case len(current) > rc.ReplicasDesired:
+		return rc.unschedule(current[rc.ReplicasDesired:])
+	}
+	return nil
+}
+
+func (rc *ReplicationController) schedule(n int, current []string) error {
+	nodes, err := rc.scheduler.EligibleNodes(rc.Manifest, rc.NodeSelector)
+	if err != nil {
+		return err
+	}
+
+	already := make(map[string]bool, len(current))
+	for _, node := range current {
+		already[node] = true
+	}
+
+	podLabels := labels.Set{}
+	for k, v := range rc.PodLabels {
+		podLabels[k] = v
+	}
+	podLabels[rcIDLabel] = rc.ID.String()
+
+	scheduled := 0
+	for _, node := range nodes {
+		if scheduled >= n {
+			break
+		}
+		if already[node] {
+			continue
+		}
+
+		if err := rc.podApplicator.SetLabels(labels.POD, node, podLabels); err != nil {
+			return err
+		}
+		scheduled++
+	}
+	return nil
+}
+
+func (rc *ReplicationController) unschedule(nodes []string) error {
+	for _, node := range nodes {
+		if err := rc.podApplicator.RemoveLabel(labels.POD, node, rcIDLabel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package rc
+
+import (
+	"sort"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/pods"
+)
+
+// SpreadScheduler wraps another Scheduler and biases its node choices
+// towards spreading pods matching SpreadKey as evenly as possible across
+// nodes, rather than accepting whatever order the inner scheduler returns.
+type SpreadScheduler struct {
+	inner      Scheduler
+	podLabeler labels.Applicator
+	spreadKey  labels.Selector
+}
+
+// NewSpreadScheduler returns a SpreadScheduler that ranks the nodes
+// returned by inner using how many existing pods matching spreadKey
+// (typically something like "deployment-id=<id>" or "service=foo") are
+// already labeled on each candidate node.
+func NewSpreadScheduler(inner Scheduler, podLabeler labels.Applicator, spreadKey labels.Selector) *SpreadScheduler {
+	return &SpreadScheduler{
+		inner:      inner,
+		podLabeler: podLabeler,
+		spreadKey:  spreadKey,
+	}
+}
+
+// EligibleNodes asks the inner scheduler for candidates, then sorts them by
+// ascending count of spreadKey-matching pods already on the node (ties
+// broken by hostname), so that callers consuming the first N get the nodes
+// with the least co-location.
+func (s *SpreadScheduler) EligibleNodes(manifest pods.Manifest, selector labels.Selector) ([]string, error) {
+	candidates, err := s.inner.EligibleNodes(manifest, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.countsByNode(candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	maxCount := 0
+	for _, count := range counts {
+		if count > maxCount {
+			maxCount = count
+		}
+	}
+
+	priorities := make(map[string]int, len(candidates))
+	for _, node := range candidates {
+		priorities[node] = maxCount - counts[node]
+	}
+
+	sorted := make([]string, len(candidates))
+	copy(sorted, candidates)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if priorities[a] != priorities[b] {
+			return priorities[a] > priorities[b]
+		}
+		return a < b
+	})
+
+	return sorted, nil
+}
+
+// countsByNode returns, for each candidate node, how many pods labeled on
+// that node match s.spreadKey.
+func (s *SpreadScheduler) countsByNode(candidates []string) (map[string]int, error) {
+	matches, err := s.podLabeler.GetMatches(s.spreadKey, labels.POD)
+	if err != nil {
+		return nil, err
+	}
+
+	candidateSet := make(map[string]bool, len(candidates))
+	for _, node := range candidates {
+		candidateSet[node] = false
+	}
+
+	counts := make(map[string]int, len(candidates))
+	for _, match := range matches {
+		node := match.Labels.Get("node")
+		if _, ok := candidateSet[node]; ok {
+			counts[node]++
+		}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,59 @@
+package rc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/pods"
+)
+
+// fakeInnerScheduler always returns the same fixed node list, regardless of
+// manifest or selector, so tests can focus on SpreadScheduler's ranking.
+type fakeInnerScheduler struct {
+	nodes []string
+}
+
+func (s fakeInnerScheduler) EligibleNodes(_ pods.Manifest, _ labels.Selector) ([]string, error) {
+	return s.nodes, nil
+}
+
+func TestSpreadSchedulerPrefersLeastCrowdedNodes(t *testing.T) {
+	// node1 already has 2 matching pods, node2 has 1, node3 has 0.
+	matches := []labels.Labeled{
+		{ID: "podA", Labels: labels.Set{"node": "node1", "service": "foo"}},
+		{ID: "podB", Labels: labels.Set{"node": "node1", "service": "foo"}},
+		{ID: "podC", Labels: labels.Set{"node": "node2", "service": "foo"}},
+	}
+
+	applicator := &fakeApplicator{
+		getMatches: func(selector labels.Selector, labelType labels.Type) ([]labels.Labeled, error) {
+			return matches, nil
+		},
+	}
+
+	spreadKey, err := labels.Parse("service=foo")
+	if err != nil {
+		t.Fatalf("could not parse spread key: %s", err)
+	}
+
+	inner := fakeInnerScheduler{nodes: []string{"node1", "node2", "node3"}}
+	scheduler := NewSpreadScheduler(inner, applicator, spreadKey)
+
+	ranked, err := scheduler.EligibleNodes(nil, nil)
+	if err != nil {
+		t.Fatalf("EligibleNodes failed: %s", err)
+	}
+
+	want := []string{"node3", "node2", "node1"}
+	if !reflect.DeepEqual(ranked, want) {
+		t.Fatalf("expected nodes ranked least-to-most crowded %v, got %v", want, ranked)
+	}
+
+	// A request for 2 nodes should pick the 0-pod and 1-pod hosts.
+	picked := ranked[:2]
+	wantPicked := []string{"node3", "node2"}
+	if !reflect.DeepEqual(picked, wantPicked) {
+		t.Fatalf("expected the 2 least-crowded nodes %v, got %v", wantPicked, picked)
+	}
+}
@@ -0,0 +1,62 @@
+package rc
+
+import (
+	"github.com/square/p2/pkg/labels"
+)
+
+// WatchCurrentNodes watches the nodes this RC currently has pods on,
+// pushing an updated node list only when something actually changes,
+// instead of requiring callers to poll CurrentNodes() on a timer. It is
+// backed by labels.Applicator.WatchMatches against the same rc_id index
+// CurrentNodes() reads, so it works the same whether the RC's
+// podApplicator is a ConsulApplicator or an HttpApplicator.
+func (rc *ReplicationController) WatchCurrentNodes(quit <-chan struct{}) (<-chan []string, <-chan error) {
+	nodes := make(chan []string)
+	errs := make(chan error)
+
+	go func() {
+		defer close(nodes)
+		defer close(errs)
+
+		selector, err := rc.rcIDSelector()
+		if err != nil {
+			select {
+			case errs <- err:
+			case <-quit:
+			}
+			return
+		}
+		matches, watchErrs := rc.podApplicator.WatchMatches(selector, labels.POD, quit)
+
+		for {
+			select {
+			case <-quit:
+				return
+			case err, ok := <-watchErrs:
+				if !ok {
+					return
+				}
+				select {
+				case errs <- err:
+				case <-quit:
+					return
+				}
+			case matched, ok := <-matches:
+				if !ok {
+					return
+				}
+				currentNodes := make([]string, 0, len(matched))
+				for _, m := range matched {
+					currentNodes = append(currentNodes, m.ID)
+				}
+				select {
+				case nodes <- currentNodes:
+				case <-quit:
+					return
+				}
+			}
+		}
+	}()
+
+	return nodes, errs
+}
@@ -0,0 +1,126 @@
+package rc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/rc/fields"
+)
+
+// fakeApplicator is a minimal labels.Applicator double that lets tests
+// drive WatchMatches directly, without a real consul agent.
+type fakeApplicator struct {
+	watchMatches func(selector labels.Selector, labelType labels.Type, quit <-chan struct{}) (<-chan []labels.Labeled, <-chan error)
+	getMatches   func(selector labels.Selector, labelType labels.Type) ([]labels.Labeled, error)
+	setLabels    func(labelType labels.Type, id string, values labels.Set) error
+}
+
+func (f *fakeApplicator) GetLabels(labelType labels.Type, id string) (labels.Labeled, error) {
+	return labels.Labeled{}, nil
+}
+
+func (f *fakeApplicator) GetMatches(selector labels.Selector, labelType labels.Type) ([]labels.Labeled, error) {
+	if f.getMatches == nil {
+		return nil, nil
+	}
+	return f.getMatches(selector, labelType)
+}
+
+func (f *fakeApplicator) SetLabels(labelType labels.Type, id string, values labels.Set) error {
+	if f.setLabels == nil {
+		return nil
+	}
+	return f.setLabels(labelType, id, values)
+}
+
+func (f *fakeApplicator) RemoveLabel(labelType labels.Type, id, key string) error {
+	return nil
+}
+
+func (f *fakeApplicator) WatchMatches(selector labels.Selector, labelType labels.Type, quit <-chan struct{}) (<-chan []labels.Labeled, <-chan error) {
+	return f.watchMatches(selector, labelType, quit)
+}
+
+func TestWatchCurrentNodesFiresOncePerChange(t *testing.T) {
+	changes := make(chan []labels.Labeled)
+	applicator := &fakeApplicator{
+		watchMatches: func(selector labels.Selector, labelType labels.Type, quit <-chan struct{}) (<-chan []labels.Labeled, <-chan error) {
+			errs := make(chan error)
+			out := make(chan []labels.Labeled)
+			go func() {
+				defer close(out)
+				defer close(errs)
+				for {
+					select {
+					case <-quit:
+						return
+					case c, ok := <-changes:
+						if !ok {
+							return
+						}
+						select {
+						case out <- c:
+						case <-quit:
+							return
+						}
+					}
+				}
+			}()
+			return out, errs
+		},
+	}
+
+	replicationController := New(
+		fields.RC{ID: fields.ID("some-rc")},
+		nil,
+		nil,
+		nil,
+		applicator,
+	)
+
+	quit := make(chan struct{})
+	defer close(quit)
+
+	nodes, errs := replicationController.WatchCurrentNodes(quit)
+
+	send := func(ids ...string) []labels.Labeled {
+		labeled := make([]labels.Labeled, len(ids))
+		for i, id := range ids {
+			labeled[i] = labels.Labeled{ID: id}
+		}
+		return labeled
+	}
+
+	wantChanges := [][]labels.Labeled{
+		send("nodeA"),
+		send("nodeA", "nodeB"),
+		send("nodeB"),
+	}
+
+	for _, change := range wantChanges {
+		select {
+		case changes <- change:
+		case <-time.After(time.Second):
+			t.Fatal("timed out sending label change")
+		}
+
+		select {
+		case got := <-nodes:
+			if len(got) != len(change) {
+				t.Fatalf("expected %d nodes, got %d: %v", len(change), len(got), got)
+			}
+		case err := <-errs:
+			t.Fatalf("unexpected error: %s", err)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for WatchCurrentNodes to fire")
+		}
+
+		// No second emission should follow a single change.
+		select {
+		case extra := <-nodes:
+			t.Fatalf("expected exactly one emission per change, got extra: %v", extra)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}